@@ -0,0 +1,342 @@
+package gophermon
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/femot/pgoapi-go/api"
+)
+
+const (
+	ElevationApiURL     = "https://maps.googleapis.com/maps/api/elevation/json"
+	OpenElevationApiURL = "https://api.open-elevation.com/api/v1/lookup"
+
+	// defaultElevationTimeout bounds a single HTTP round-trip to an elevation API.
+	defaultElevationTimeout = 10 * time.Second
+	// defaultElevationRetries is how many times a request is retried on a transient failure.
+	defaultElevationRetries = 3
+	// maxElevationBackoff caps the exponential backoff between retries.
+	maxElevationBackoff = 30 * time.Second
+)
+
+// ElevationProvider is the common interface for looking up the altitude of a set of locations.
+// Implementations are free to hit a remote API, read local tiles or return canned data for tests.
+type ElevationProvider interface {
+	// LookupAltitudes returns one altitude (in meters) per location, in the same order as locations.
+	LookupAltitudes(locations []*api.Location) ([]float64, error)
+}
+
+// GoogleElevationProvider looks up altitudes using Google's Elevation API. It requires an API key.
+type GoogleElevationProvider struct {
+	Key string
+	// QPS caps how many requests per second are sent to the API. 0 means unlimited.
+	QPS float64
+	// MaxRetries is how many times a request is retried after a 5xx or OVER_QUERY_LIMIT response,
+	// with exponential backoff between attempts. Defaults to defaultElevationRetries.
+	MaxRetries int
+
+	client *http.Client
+}
+
+// NewGoogleElevationProvider creates a GoogleElevationProvider using the given Google Maps API key.
+func NewGoogleElevationProvider(key string) *GoogleElevationProvider {
+	return &GoogleElevationProvider{
+		Key:        key,
+		MaxRetries: defaultElevationRetries,
+		client:     &http.Client{Timeout: defaultElevationTimeout},
+	}
+}
+
+// LookupAltitudes uses Google's Elevation API to get the altitude for a given slice of api.Location.
+func (g *GoogleElevationProvider) LookupAltitudes(locations []*api.Location) ([]float64, error) {
+	if g.client == nil {
+		g.client = &http.Client{Timeout: defaultElevationTimeout}
+	}
+	latLngPairs := make([]string, len(locations))
+	elevations := make([]float64, len(locations))
+	// Build request URL
+	for i, llp := range locations {
+		latLngPairs[i] = fmt.Sprintf("%f,%f", llp.Lat, llp.Lon)
+	}
+	// Docs say 512 per request, but tests were only successful up to 405 requests.
+	// See https://developers.google.com/maps/documentation/elevation/usage-limits
+	rateLimit := 405
+	numRequests := int(math.Ceil(float64(len(locations)) / float64(rateLimit)))
+	// Perform request
+	for i := 0; i < numRequests; i++ {
+		if i > 0 {
+			g.throttle()
+		}
+		upper := i*rateLimit + rateLimit
+		if upper > len(latLngPairs) {
+			upper = len(latLngPairs)
+		}
+		requestURL := fmt.Sprintf("%s?locations=%s&key=%s", ElevationApiURL, strings.Join(latLngPairs[i*rateLimit:upper], "|"), g.Key)
+		response, err := g.getWithRetry(requestURL)
+		if err != nil {
+			return elevations, err
+		}
+		for j, e := range response.Results {
+			elevations[j+(rateLimit*i)] = e.Elevation
+		}
+	}
+	return elevations, nil
+}
+
+// throttle sleeps long enough to respect QPS before the next request is sent.
+func (g *GoogleElevationProvider) throttle() {
+	if g.QPS <= 0 {
+		return
+	}
+	time.Sleep(time.Duration(float64(time.Second) / g.QPS))
+}
+
+// getWithRetry performs the request, retrying with exponential backoff on 5xx responses and
+// Google's own OVER_QUERY_LIMIT status.
+func (g *GoogleElevationProvider) getWithRetry(requestURL string) (*ElevationApiResults, error) {
+	maxRetries := g.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = defaultElevationRetries
+	}
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			backoff := time.Duration(1<<uint(attempt)) * time.Second
+			if backoff > maxElevationBackoff {
+				backoff = maxElevationBackoff
+			}
+			time.Sleep(backoff)
+		}
+		response, retriable, err := g.get(requestURL)
+		if err == nil {
+			return response, nil
+		}
+		lastErr = err
+		if !retriable {
+			return nil, err
+		}
+	}
+	return nil, lastErr
+}
+
+// get performs a single request. The bool return indicates whether the error (if any) is worth
+// retrying.
+func (g *GoogleElevationProvider) get(requestURL string) (*ElevationApiResults, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultElevationTimeout)
+	defer cancel()
+	req, err := http.NewRequest("GET", requestURL, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	req = req.WithContext(ctx)
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return nil, true, fmt.Errorf("gophermon: elevation API returned status %d", resp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, err
+	}
+	response := &ElevationApiResults{}
+	if err := json.Unmarshal(body, response); err != nil {
+		return nil, false, err
+	}
+	if response.Status == "OVER_QUERY_LIMIT" {
+		return nil, true, fmt.Errorf("gophermon: elevation API status %s", response.Status)
+	}
+	return response, false, nil
+}
+
+// ElevationApiResult is the structure of the individual elevation results sent back by Google's elevation API.
+type ElevationApiResult struct {
+	Elevation  float64
+	Location   api.Location
+	Resolution float64
+}
+
+// ElevationApiResults is the structure of the response from Google's elevation API.
+type ElevationApiResults struct {
+	Results []ElevationApiResult
+	Status  string
+}
+
+// OpenElevationProvider looks up altitudes using the Open-Elevation/OpenTopoData API, which needs no key.
+type OpenElevationProvider struct {
+	// BaseURL defaults to OpenElevationApiURL if empty. Set it to point at a self-hosted
+	// Open-Elevation or OpenTopoData instance instead.
+	BaseURL string
+}
+
+type openElevationRequest struct {
+	Locations []openElevationLocation `json:"locations"`
+}
+
+type openElevationLocation struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+type openElevationResponse struct {
+	Results []struct {
+		Elevation float64 `json:"elevation"`
+	} `json:"results"`
+}
+
+// LookupAltitudes posts the locations to the Open-Elevation compatible API in a single batch.
+func (o *OpenElevationProvider) LookupAltitudes(locations []*api.Location) ([]float64, error) {
+	baseURL := o.BaseURL
+	if baseURL == "" {
+		baseURL = OpenElevationApiURL
+	}
+	req := openElevationRequest{Locations: make([]openElevationLocation, len(locations))}
+	for i, l := range locations {
+		req.Locations[i] = openElevationLocation{Latitude: l.Lat, Longitude: l.Lon}
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.Post(baseURL, "application/json", strings.NewReader(string(body)))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	parsed := &openElevationResponse{}
+	if err := json.Unmarshal(respBody, parsed); err != nil {
+		return nil, err
+	}
+	if len(parsed.Results) != len(locations) {
+		return nil, fmt.Errorf("gophermon: open-elevation returned %d results for %d locations", len(parsed.Results), len(locations))
+	}
+	elevations := make([]float64, len(locations))
+	for i, r := range parsed.Results {
+		elevations[i] = r.Elevation
+	}
+	return elevations, nil
+}
+
+// FileElevationProvider reads altitudes from SRTM .hgt tiles stored on disk, so lookups need
+// no network access. Tiles are named by the latitude/longitude of their south-west corner, e.g.
+// "N37W122.hgt", and may be either SRTM1 (3601x3601 samples) or SRTM3 (1201x1201 samples).
+type FileElevationProvider struct {
+	Dir string
+
+	tiles map[string][]byte
+}
+
+// NewFileElevationProvider creates a FileElevationProvider that reads tiles from dir on demand.
+func NewFileElevationProvider(dir string) *FileElevationProvider {
+	return &FileElevationProvider{Dir: dir, tiles: make(map[string][]byte)}
+}
+
+// LookupAltitudes reads the altitude of each location from the .hgt tile covering it.
+func (f *FileElevationProvider) LookupAltitudes(locations []*api.Location) ([]float64, error) {
+	elevations := make([]float64, len(locations))
+	for i, l := range locations {
+		tile, err := f.loadTile(l.Lat, l.Lon)
+		if err != nil {
+			return elevations, err
+		}
+		elevations[i] = sampleHgtTile(tile, l.Lat, l.Lon)
+	}
+	return elevations, nil
+}
+
+func (f *FileElevationProvider) loadTile(lat, lon float64) ([]byte, error) {
+	name := hgtTileName(lat, lon)
+	if tile, ok := f.tiles[name]; ok {
+		return tile, nil
+	}
+	data, err := ioutil.ReadFile(filepath.Join(f.Dir, name+".hgt"))
+	if err != nil {
+		return nil, err
+	}
+	f.tiles[name] = data
+	return data, nil
+}
+
+// hgtTileName returns the SRTM tile name (without extension) covering the given coordinates.
+func hgtTileName(lat, lon float64) string {
+	latCell := int(math.Floor(lat))
+	lonCell := int(math.Floor(lon))
+	ns, ew := "N", "E"
+	if latCell < 0 {
+		ns = "S"
+		latCell = -latCell
+	}
+	if lonCell < 0 {
+		ew = "W"
+		lonCell = -lonCell
+	}
+	return fmt.Sprintf("%s%02d%s%03d", ns, latCell, ew, lonCell)
+}
+
+// sampleHgtTile reads the elevation sample nearest to (lat, lon) from a raw SRTM tile buffer.
+// Samples are big-endian 16-bit integers, stored row-major starting at the tile's north-west corner.
+func sampleHgtTile(tile []byte, lat, lon float64) float64 {
+	samples := int(math.Sqrt(float64(len(tile) / 2)))
+	if samples == 0 {
+		return 0
+	}
+	fracLat := lat - math.Floor(lat)
+	fracLon := lon - math.Floor(lon)
+	row := int(math.Round(float64(samples-1) * (1 - fracLat)))
+	col := int(math.Round(float64(samples-1) * fracLon))
+	offset := 2 * (row*samples + col)
+	if offset < 0 || offset+2 > len(tile) {
+		return 0
+	}
+	return float64(int16(binary.BigEndian.Uint16(tile[offset : offset+2])))
+}
+
+// ConstantElevationProvider always returns the same altitude. It's useful for tests and for
+// users who don't care about altitude accuracy.
+type ConstantElevationProvider struct {
+	Altitude float64
+}
+
+// LookupAltitudes returns Altitude for every location.
+func (c ConstantElevationProvider) LookupAltitudes(locations []*api.Location) ([]float64, error) {
+	elevations := make([]float64, len(locations))
+	for i := range elevations {
+		elevations[i] = c.Altitude
+	}
+	return elevations, nil
+}
+
+// GetAltitude uses Google's elevation API to get the altitude for a given slice of api.Location.
+//
+// Deprecated: use an ElevationProvider (e.g. GoogleElevationProvider) instead.
+func GetAltitude(locations []*api.Location, key string) ([]float64, error) {
+	return NewGoogleElevationProvider(key).LookupAltitudes(locations)
+}
+
+// SetCorrectAltitudes uses GetAltitude to set the correct altitude for a slice of api.Location.
+//
+// Deprecated: use an ElevationProvider (e.g. GoogleElevationProvider) instead.
+func SetCorrectAltitudes(locations []*api.Location, key string) error {
+	elevations, err := GetAltitude(locations, key)
+	if err != nil {
+		return err
+	}
+	for i, e := range elevations {
+		locations[i].Alt = e
+	}
+	return nil
+}
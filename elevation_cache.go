@@ -0,0 +1,105 @@
+package gophermon
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/femot/pgoapi-go/api"
+)
+
+var elevationBucket = []byte("elevations")
+
+// CachedElevationProvider wraps another ElevationProvider with a persistent on-disk cache, so
+// repeated lookups for the same location (e.g. overlapping honeycomb scans) don't hit the
+// network or local tiles again.
+type CachedElevationProvider struct {
+	Source ElevationProvider
+
+	db        *bolt.DB
+	precision float64 // cell size in degrees; locations are rounded to this grid before caching
+}
+
+// NewCachedElevationProvider opens (or creates) a BoltDB file at path and caches lookups made
+// through source. precision is the size in degrees of the grid cells locations are rounded to
+// before caching; 0 defaults to 0.0001 degrees (about 11 meters at the equator).
+func NewCachedElevationProvider(source ElevationProvider, path string, precision float64) (*CachedElevationProvider, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(elevationBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if precision <= 0 {
+		precision = 0.0001
+	}
+	return &CachedElevationProvider{Source: source, db: db, precision: precision}, nil
+}
+
+// Close releases the underlying BoltDB file.
+func (c *CachedElevationProvider) Close() error {
+	return c.db.Close()
+}
+
+// cellKey rounds (lat, lon) to the cache's grid and returns the BoltDB key for that cell.
+func (c *CachedElevationProvider) cellKey(lat, lon float64) []byte {
+	rLat := math.Round(lat/c.precision) * c.precision
+	rLon := math.Round(lon/c.precision) * c.precision
+	return []byte(fmt.Sprintf("%.6f,%.6f", rLat, rLon))
+}
+
+// LookupAltitudes returns cached altitudes where available and falls back to Source for the
+// rest, storing the newly fetched altitudes in the cache for next time.
+func (c *CachedElevationProvider) LookupAltitudes(locations []*api.Location) ([]float64, error) {
+	elevations := make([]float64, len(locations))
+	missing := make([]*api.Location, 0)
+	missingIndex := make([]int, 0)
+
+	err := c.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(elevationBucket)
+		for i, l := range locations {
+			v := b.Get(c.cellKey(l.Lat, l.Lon))
+			if v == nil {
+				missing = append(missing, l)
+				missingIndex = append(missingIndex, i)
+				continue
+			}
+			elevations[i] = math.Float64frombits(binary.BigEndian.Uint64(v))
+		}
+		return nil
+	})
+	if err != nil {
+		return elevations, err
+	}
+	if len(missing) == 0 {
+		return elevations, nil
+	}
+
+	fetched, err := c.Source.LookupAltitudes(missing)
+	if err != nil {
+		return elevations, err
+	}
+
+	err = c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(elevationBucket)
+		for i, e := range fetched {
+			idx := missingIndex[i]
+			elevations[idx] = e
+			buf := make([]byte, 8)
+			binary.BigEndian.PutUint64(buf, math.Float64bits(e))
+			if err := b.Put(c.cellKey(missing[i].Lat, missing[i].Lon), buf); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return elevations, err
+}
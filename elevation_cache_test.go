@@ -0,0 +1,71 @@
+package gophermon
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/femot/pgoapi-go/api"
+)
+
+// countingElevationProvider records how many locations it was asked to look up.
+type countingElevationProvider struct {
+	calls int
+	alt   float64
+}
+
+func (c *countingElevationProvider) LookupAltitudes(locations []*api.Location) ([]float64, error) {
+	c.calls += len(locations)
+	elevations := make([]float64, len(locations))
+	for i := range elevations {
+		elevations[i] = c.alt
+	}
+	return elevations, nil
+}
+
+func TestCachedElevationProvider_CellKeyRounding(t *testing.T) {
+	c := &CachedElevationProvider{precision: 0.0001}
+
+	// Two points within the same grid cell must produce the same key.
+	a := c.cellKey(37.12342, -122.54321)
+	b := c.cellKey(37.123421, -122.543211)
+	if string(a) != string(b) {
+		t.Errorf("expected points within precision to share a cell key, got %q and %q", a, b)
+	}
+
+	// A point a full cell away must produce a different key.
+	d := c.cellKey(37.12342+0.0005, -122.54321)
+	if string(a) == string(d) {
+		t.Errorf("expected points a cell apart to have different cell keys, both got %q", a)
+	}
+}
+
+func TestCachedElevationProvider_LookupAltitudes_CachesByCell(t *testing.T) {
+	source := &countingElevationProvider{alt: 42}
+	path := filepath.Join(t.TempDir(), "elevation.db")
+	cache, err := NewCachedElevationProvider(source, path, 0.0001)
+	if err != nil {
+		t.Fatalf("NewCachedElevationProvider: %s", err)
+	}
+	defer cache.Close()
+
+	locations := []*api.Location{{Lat: 37.1, Lon: -122.1}}
+
+	elevations, err := cache.LookupAltitudes(locations)
+	if err != nil {
+		t.Fatalf("LookupAltitudes: %s", err)
+	}
+	if elevations[0] != 42 {
+		t.Errorf("expected altitude 42, got %f", elevations[0])
+	}
+	if source.calls != 1 {
+		t.Errorf("expected 1 call to the source on a cold cache, got %d", source.calls)
+	}
+
+	// A second lookup of the same location should be served entirely from the cache.
+	if _, err := cache.LookupAltitudes(locations); err != nil {
+		t.Fatalf("LookupAltitudes (cached): %s", err)
+	}
+	if source.calls != 1 {
+		t.Errorf("expected the cached lookup to skip the source, but it was called %d times", source.calls)
+	}
+}
@@ -0,0 +1,121 @@
+package gophermon
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/femot/pgoapi-go/api"
+)
+
+func TestHgtTileName(t *testing.T) {
+	cases := []struct {
+		lat, lon float64
+		want     string
+	}{
+		{37.5, -122.3, "N37W123"},
+		{-33.9, 18.4, "S34E018"},
+		{0, 0, "N00E000"},
+	}
+	for _, c := range cases {
+		if got := hgtTileName(c.lat, c.lon); got != c.want {
+			t.Errorf("hgtTileName(%f, %f) = %q, want %q", c.lat, c.lon, got, c.want)
+		}
+	}
+}
+
+// newTestHgtTile builds a 2x2 SRTM tile (big-endian int16, row-major from the north-west corner)
+// with a distinct value in each corner, so tests can tell rows and columns apart.
+func newTestHgtTile(nw, ne, sw, se int16) []byte {
+	tile := make([]byte, 8)
+	binary.BigEndian.PutUint16(tile[0:2], uint16(nw))
+	binary.BigEndian.PutUint16(tile[2:4], uint16(ne))
+	binary.BigEndian.PutUint16(tile[4:6], uint16(sw))
+	binary.BigEndian.PutUint16(tile[6:8], uint16(se))
+	return tile
+}
+
+func TestSampleHgtTile_RowsRunNorthToSouth(t *testing.T) {
+	tile := newTestHgtTile(100, 200, 300, 400)
+
+	if got := sampleHgtTile(tile, 0.9999, 0.0001); got != 100 {
+		t.Errorf("expected the north-west sample, got %f", got)
+	}
+	if got := sampleHgtTile(tile, 0.9999, 0.9999); got != 200 {
+		t.Errorf("expected the north-east sample, got %f", got)
+	}
+	if got := sampleHgtTile(tile, 0.0001, 0.0001); got != 300 {
+		t.Errorf("expected the south-west sample, got %f", got)
+	}
+	if got := sampleHgtTile(tile, 0.0001, 0.9999); got != 400 {
+		t.Errorf("expected the south-east sample, got %f", got)
+	}
+}
+
+func TestSampleHgtTile_EmptyTile(t *testing.T) {
+	if got := sampleHgtTile(nil, 37.1, -122.1); got != 0 {
+		t.Errorf("expected 0 for an empty tile, got %f", got)
+	}
+}
+
+func TestOpenElevationProvider_LookupAltitudes(t *testing.T) {
+	var gotReq openElevationRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&gotReq); err != nil {
+			t.Fatalf("decoding request body: %s", err)
+		}
+		resp := openElevationResponse{}
+		for i := range gotReq.Locations {
+			resp.Results = append(resp.Results, struct {
+				Elevation float64 `json:"elevation"`
+			}{Elevation: float64(i) + 1})
+		}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			t.Fatalf("encoding response body: %s", err)
+		}
+	}))
+	defer server.Close()
+
+	provider := &OpenElevationProvider{BaseURL: server.URL}
+	locations := []*api.Location{{Lat: 37.1, Lon: -122.1}, {Lat: 37.2, Lon: -122.2}}
+
+	elevations, err := provider.LookupAltitudes(locations)
+	if err != nil {
+		t.Fatalf("LookupAltitudes: %s", err)
+	}
+	if len(elevations) != 2 || elevations[0] != 1 || elevations[1] != 2 {
+		t.Errorf("unexpected elevations: %+v", elevations)
+	}
+	if len(gotReq.Locations) != 2 || gotReq.Locations[0].Latitude != 37.1 || gotReq.Locations[0].Longitude != -122.1 {
+		t.Errorf("unexpected request body: %+v", gotReq.Locations)
+	}
+}
+
+func TestOpenElevationProvider_LookupAltitudes_ResultCountMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results":[]}`))
+	}))
+	defer server.Close()
+
+	provider := &OpenElevationProvider{BaseURL: server.URL}
+	if _, err := provider.LookupAltitudes([]*api.Location{{Lat: 1, Lon: 1}}); err == nil {
+		t.Fatal("expected an error when the API returns fewer results than requested locations")
+	}
+}
+
+func TestConstantElevationProvider_LookupAltitudes(t *testing.T) {
+	provider := ConstantElevationProvider{Altitude: 123}
+	locations := []*api.Location{{Lat: 1, Lon: 1}, {Lat: 2, Lon: 2}}
+
+	elevations, err := provider.LookupAltitudes(locations)
+	if err != nil {
+		t.Fatalf("LookupAltitudes: %s", err)
+	}
+	for i, e := range elevations {
+		if e != 123 {
+			t.Errorf("elevations[%d] = %f, want 123", i, e)
+		}
+	}
+}
@@ -1,14 +1,9 @@
 package gophermon
 
 import (
-	"encoding/json"
-	"fmt"
-	"io/ioutil"
 	"log"
 	"math"
 	"math/rand"
-	"net/http"
-	"strings"
 
 	"github.com/kellydunn/golang-geo"
 
@@ -16,81 +11,12 @@ import (
 )
 
 const (
-	NORTH           = 0
-	EAST            = 90
-	SOUTH           = 180
-	WEST            = 270
-	ElevationApiURL = "https://maps.googleapis.com/maps/api/elevation/json"
+	NORTH = 0
+	EAST  = 90
+	SOUTH = 180
+	WEST  = 270
 )
 
-// GetAltitude uses Googles elevation API to get the altitude for a given slice of api.Location.
-func GetAltitude(locations []*api.Location, key string) ([]float64, error) {
-	latLngPairs := make([]string, len(locations))
-	elevations := make([]float64, len(locations))
-	// Build request URL
-	for i, llp := range locations {
-		latLngPairs[i] = fmt.Sprintf("%f,%f", llp.Lat, llp.Lon)
-	}
-	// Docs say 512 per request, but tests were only successful up to 405 requests.
-	// See https://developers.google.com/maps/documentation/elevation/usage-limits
-	rateLimit := 405
-	numRequests := int(math.Ceil(float64(len(locations)) / float64(rateLimit)))
-	// Perform request
-	for i := 0; i < numRequests; i++ {
-		upper := i*rateLimit + rateLimit
-		if upper > len(latLngPairs) {
-			upper = len(latLngPairs)
-		}
-		requestURL := fmt.Sprintf("%s?locations=%s&key=%s", ElevationApiURL, strings.Join(latLngPairs[i*rateLimit:upper], "|"), key)
-		//log.Fatal(requestURL)
-		resp, err := http.Get(requestURL)
-		if err != nil {
-			return elevations, err
-		}
-		defer resp.Body.Close()
-		// Read response
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return elevations, err
-		}
-		// Parse response
-		response := &ElevationApiResults{}
-		err = json.Unmarshal(body, response)
-		if err != nil {
-			return elevations, err
-		}
-		for j, e := range response.Results {
-			elevations[j+(rateLimit*i)] = e.Elevation
-		}
-	}
-	return elevations, nil
-}
-
-// ElevationApiResult is the structure of the individual elevation results sent back by Google's elevation API.
-type ElevationApiResult struct {
-	Elevation  float64
-	Location   api.Location
-	Resolution float64
-}
-
-// ElevationApiResults is the structure of the response from Google's elevation API.
-type ElevationApiResults struct {
-	Results []ElevationApiResult
-	Status  string
-}
-
-// SetCorrectAltitudes uses GetAltitude to set the correct altitude for a slice of api.Location.
-func SetCorrectAltitudes(locations []*api.Location, key string) error {
-	elevations, err := GetAltitude(locations, key)
-	if err != nil {
-		return err
-	}
-	for i, e := range elevations {
-		locations[i].Alt = e
-	}
-	return nil
-}
-
 // LocationProvider is a common interface for continuously providing locations.
 type LocationProvider interface {
 	// NextLocation requests a new location
@@ -151,8 +77,9 @@ type PolygonProvider struct {
 	currentLocation int
 }
 
-// NewPolygonProvider creates a new PolygonProvider.
-func NewPolygonProvider(polyLocations []api.Location, gmapsKey string) (*PolygonProvider, error) {
+// NewPolygonProvider creates a new PolygonProvider. Altitudes for the generated locations are
+// looked up through elevation.
+func NewPolygonProvider(polyLocations []api.Location, elevation ElevationProvider) (*PolygonProvider, error) {
 	// Create the polygon
 	polyPoints := make([]*geo.Point, 0)
 	for _, p := range polyLocations {
@@ -178,10 +105,13 @@ func NewPolygonProvider(polyLocations []api.Location, gmapsKey string) (*Polygon
 		}
 	}
 	// Set Altitudes
-	err := SetCorrectAltitudes(final, gmapsKey)
+	elevations, err := elevation.LookupAltitudes(final)
 	if err != nil {
 		return &PolygonProvider{}, err
 	}
+	for i, e := range elevations {
+		final[i].Alt = e
+	}
 
 	return &PolygonProvider{
 		Polygon:         polygon,
@@ -1,13 +1,20 @@
 package mapsql
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"sync"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 )
 
+// DbConnection identifies a MySQL database to persist scanned pokemon and locations to. Its
+// zero value plus the exported fields is a valid DbConnection, just as it was before connection
+// pooling was introduced: every method resolves its connection pool lazily through pools, keyed
+// by DSN, so a plain struct literal (`DbConnection{Username: ..., ...}`) and one built through
+// NewDbConnection behave identically and share the same pool.
 type DbConnection struct {
 	Username string
 	Password string
@@ -16,43 +23,199 @@ type DbConnection struct {
 	Database string
 }
 
-func (d DbConnection) AddPokemon(encounterId, spawnpointId string, pokemonId int, latitude, longitude float64, disappearTime time.Time) error {
-	insert := fmt.Sprintf("INSERT INTO `pokemon` (encounter_id,spawnpoint_id,pokemon_id,latitude,longitude,disappear_time) "+
-		"VALUES ('%s', '%s', %d, %.14f, %.14f, '%s')", encounterId, spawnpointId, pokemonId, latitude, longitude, disappearTime.Format("2006-01-2 15:04:05"))
-	_, err := d.ExecuteStatement(insert)
+var (
+	poolsMu sync.Mutex
+	pools   = map[string]*sql.DB{}
+)
+
+// NewDbConnection builds a DbConnection and verifies its database is reachable. Using it is
+// optional: a DbConnection built as a plain struct literal works the same way, just without the
+// upfront connectivity check.
+func NewDbConnection(username, password, host string, port int, database string) (DbConnection, error) {
+	d := DbConnection{Username: username, Password: password, Host: host, Port: port, Database: database}
+	db, err := d.pool()
+	if err != nil {
+		return DbConnection{}, err
+	}
+	if err := db.Ping(); err != nil {
+		return DbConnection{}, err
+	}
+	return d, nil
+}
+
+func dataSourceName(d DbConnection) string {
+	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", d.Username, d.Password, d.Host, d.Port, d.Database)
+}
+
+// pool returns the shared *sql.DB for d's DSN, opening and caching it on first use. Keying the
+// cache by DSN (rather than storing the pool on the struct itself) means every DbConnection value
+// with the same connection details shares one pool, regardless of how many copies of the struct
+// exist or whether they went through NewDbConnection.
+func (d DbConnection) pool() (*sql.DB, error) {
+	dsn := dataSourceName(d)
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+	if db, ok := pools[dsn]; ok {
+		return db, nil
+	}
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+	pools[dsn] = db
+	return db, nil
+}
+
+// Close closes the underlying connection pool and forgets it, so a later call reopens a fresh
+// one instead of reusing a closed *sql.DB.
+func (d DbConnection) Close() error {
+	dsn := dataSourceName(d)
+	poolsMu.Lock()
+	db, ok := pools[dsn]
+	if ok {
+		delete(pools, dsn)
+	}
+	poolsMu.Unlock()
+	if !ok {
+		return nil
+	}
+	return db.Close()
+}
+
+// AddPokemonCtx inserts a single pokemon sighting using a prepared statement.
+func (d DbConnection) AddPokemonCtx(ctx context.Context, encounterId, spawnpointId string, pokemonId int, latitude, longitude float64, disappearTime time.Time) error {
+	db, err := d.pool()
+	if err != nil {
+		return err
+	}
+	stmt, err := db.PrepareContext(ctx, "INSERT INTO `pokemon` (encounter_id,spawnpoint_id,pokemon_id,latitude,longitude,disappear_time) "+
+		"VALUES (?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.ExecContext(ctx, encounterId, spawnpointId, pokemonId, latitude, longitude, disappearTime.Format("2006-01-2 15:04:05"))
 	return err
 }
 
-func (d DbConnection) AddScannedLocation(latitude, longitude float64) error {
-	insert := fmt.Sprintf("INSERT INTO scannedlocation (latitude, longitude, last_modified) VALUES (%f, %f, '%s')", latitude, longitude, time.Now().UTC().Format("2006-01-2 15:04:05"))
-	_, err := d.ExecuteStatement(insert)
+// AddPokemon is a thin wrapper around AddPokemonCtx for backward compatibility.
+func (d DbConnection) AddPokemon(encounterId, spawnpointId string, pokemonId int, latitude, longitude float64, disappearTime time.Time) error {
+	return d.AddPokemonCtx(context.Background(), encounterId, spawnpointId, pokemonId, latitude, longitude, disappearTime)
+}
+
+// Pokemon is a single pokemon sighting, as persisted by AddPokemonBatchCtx.
+type Pokemon struct {
+	EncounterId   string
+	SpawnpointId  string
+	PokemonId     int
+	Latitude      float64
+	Longitude     float64
+	DisappearTime time.Time
+}
+
+// AddPokemonBatchCtx inserts many pokemon sightings in a single transaction, using one prepared
+// statement for all of them.
+func (d DbConnection) AddPokemonBatchCtx(ctx context.Context, pokemons []Pokemon) error {
+	db, err := d.pool()
 	if err != nil {
-		insert = fmt.Sprintf("UPDATE scannedlocation SET last_modified = '%s' WHERE latitude=%f and longitude=%f", time.Now().UTC().Format("2006-01-2 15:04:05"), latitude, longitude)
-		_, err = d.ExecuteStatement(insert)
+		return err
 	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO `pokemon` (encounter_id,spawnpoint_id,pokemon_id,latitude,longitude,disappear_time) "+
+		"VALUES (?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for _, p := range pokemons {
+		_, err := stmt.ExecContext(ctx, p.EncounterId, p.SpawnpointId, p.PokemonId, p.Latitude, p.Longitude, p.DisappearTime.Format("2006-01-2 15:04:05"))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UpsertPokemonBatchCtx inserts many pokemon sightings in a single transaction, skipping (rather
+// than erroring on) any whose encounter_id was already recorded. This assumes a unique key on
+// encounter_id.
+func (d DbConnection) UpsertPokemonBatchCtx(ctx context.Context, pokemons []Pokemon) error {
+	db, err := d.pool()
+	if err != nil {
+		return err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, "INSERT IGNORE INTO `pokemon` (encounter_id,spawnpoint_id,pokemon_id,latitude,longitude,disappear_time) "+
+		"VALUES (?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for _, p := range pokemons {
+		_, err := stmt.ExecContext(ctx, p.EncounterId, p.SpawnpointId, p.PokemonId, p.Latitude, p.Longitude, p.DisappearTime.Format("2006-01-2 15:04:05"))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UpsertScannedLocationCtx records that a location was scanned just now, bumping last_modified if
+// it was already recorded. This assumes a unique key on (latitude, longitude).
+func (d DbConnection) UpsertScannedLocationCtx(ctx context.Context, latitude, longitude float64) error {
+	db, err := d.pool()
+	if err != nil {
+		return err
+	}
+	stmt, err := db.PrepareContext(ctx, "INSERT INTO scannedlocation (latitude, longitude, last_modified) VALUES (?, ?, ?) "+
+		"ON DUPLICATE KEY UPDATE last_modified = VALUES(last_modified)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.ExecContext(ctx, latitude, longitude, time.Now().UTC().Format("2006-01-2 15:04:05"))
 	return err
 }
 
-func (d DbConnection) ExecuteQuery(query string) (*sql.Rows, error) {
-	db, err := openDb(d)
+// AddScannedLocation is a thin wrapper around UpsertScannedLocationCtx for backward compatibility.
+func (d DbConnection) AddScannedLocation(latitude, longitude float64) error {
+	return d.UpsertScannedLocationCtx(context.Background(), latitude, longitude)
+}
+
+// ExecuteQueryCtx runs an ad-hoc query against the shared connection pool.
+func (d DbConnection) ExecuteQueryCtx(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	db, err := d.pool()
 	if err != nil {
 		return nil, err
 	}
-	return db.Query(query)
+	return db.QueryContext(ctx, query, args...)
 }
 
-func (d DbConnection) ExecuteStatement(statement string) (sql.Result, error) {
-	db, err := openDb(d)
+// ExecuteQuery is a thin wrapper around ExecuteQueryCtx for backward compatibility.
+func (d DbConnection) ExecuteQuery(query string) (*sql.Rows, error) {
+	return d.ExecuteQueryCtx(context.Background(), query)
+}
+
+// ExecuteStatementCtx runs an ad-hoc statement against the shared connection pool.
+func (d DbConnection) ExecuteStatementCtx(ctx context.Context, statement string, args ...interface{}) (sql.Result, error) {
+	db, err := d.pool()
 	if err != nil {
 		return nil, err
 	}
-	result, err := db.Exec(statement)
-	db.Close()
-	return result, err
+	return db.ExecContext(ctx, statement, args...)
 }
 
-func openDb(conn DbConnection) (*sql.DB, error) {
-	sourceName := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s",
-		conn.Username, conn.Password, conn.Host, conn.Port, conn.Database)
-	return sql.Open("mysql", sourceName)
+// ExecuteStatement is a thin wrapper around ExecuteStatementCtx for backward compatibility.
+func (d DbConnection) ExecuteStatement(statement string) (sql.Result, error) {
+	return d.ExecuteStatementCtx(context.Background(), statement)
 }
@@ -0,0 +1,141 @@
+package mapsql
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// withMockPool registers db as the shared pool for conn's DSN for the duration of the test.
+func withMockPool(t *testing.T, conn DbConnection, db *sql.DB) {
+	t.Helper()
+	dsn := dataSourceName(conn)
+	pools[dsn] = db
+	t.Cleanup(func() { delete(pools, dsn) })
+}
+
+func testConn() DbConnection {
+	return DbConnection{Username: "u", Password: "p", Host: "localhost", Port: 3306, Database: "gophermon"}
+}
+
+func TestAddPokemonCtx_UsesPlaceholders(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %s", err)
+	}
+	defer db.Close()
+	conn := testConn()
+	withMockPool(t, conn, db)
+
+	mock.ExpectPrepare("INSERT INTO `pokemon`").
+		ExpectExec().
+		WithArgs("enc1", "sp1", 16, 1.5, 2.5, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err = conn.AddPokemonCtx(context.Background(), "enc1", "sp1", 16, 1.5, 2.5, time.Now())
+	if err != nil {
+		t.Fatalf("AddPokemonCtx: %s", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %s", err)
+	}
+}
+
+func TestAddPokemonCtx_EscapesUntrustedInputViaPlaceholders(t *testing.T) {
+	// Regression test for the SQL-injection vector the original fmt.Sprintf-based query had:
+	// a value containing a quote must be passed as a bound parameter, never concatenated in.
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %s", err)
+	}
+	defer db.Close()
+	conn := testConn()
+	withMockPool(t, conn, db)
+
+	malicious := "'); DROP TABLE pokemon; --"
+	mock.ExpectPrepare("INSERT INTO `pokemon`").
+		ExpectExec().
+		WithArgs(malicious, "sp1", 1, 0.0, 0.0, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	if err := conn.AddPokemonCtx(context.Background(), malicious, "sp1", 1, 0, 0, time.Now()); err != nil {
+		t.Fatalf("AddPokemonCtx: %s", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %s", err)
+	}
+}
+
+func TestUpsertPokemonBatchCtx_UsesInsertIgnoreInATransaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %s", err)
+	}
+	defer db.Close()
+	conn := testConn()
+	withMockPool(t, conn, db)
+
+	pokemons := []Pokemon{
+		{EncounterId: "a", SpawnpointId: "sp", PokemonId: 1, Latitude: 1, Longitude: 1, DisappearTime: time.Now()},
+		{EncounterId: "b", SpawnpointId: "sp", PokemonId: 2, Latitude: 2, Longitude: 2, DisappearTime: time.Now()},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectPrepare("INSERT IGNORE INTO `pokemon`")
+	mock.ExpectExec("INSERT IGNORE INTO `pokemon`").WithArgs("a", "sp", 1, 1.0, 1.0, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT IGNORE INTO `pokemon`").WithArgs("b", "sp", 2, 2.0, 2.0, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 0))
+	mock.ExpectCommit()
+
+	if err := conn.UpsertPokemonBatchCtx(context.Background(), pokemons); err != nil {
+		t.Fatalf("UpsertPokemonBatchCtx: %s", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %s", err)
+	}
+}
+
+func TestUpsertScannedLocationCtx_UsesOnDuplicateKeyUpdate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %s", err)
+	}
+	defer db.Close()
+	conn := testConn()
+	withMockPool(t, conn, db)
+
+	mock.ExpectPrepare("INSERT INTO scannedlocation .* ON DUPLICATE KEY UPDATE").
+		ExpectExec().
+		WithArgs(1.0, 2.0, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	if err := conn.UpsertScannedLocationCtx(context.Background(), 1, 2); err != nil {
+		t.Fatalf("UpsertScannedLocationCtx: %s", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %s", err)
+	}
+}
+
+func TestPool_SharedAcrossValueCopies(t *testing.T) {
+	// Regression test: a DbConnection built as a plain struct literal (the only construction
+	// pattern that existed before NewDbConnection) must resolve to the same pool as any other
+	// copy with the same connection details, not panic on a nil *sql.DB.
+	conn := testConn()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %s", err)
+	}
+	defer db.Close()
+	withMockPool(t, conn, db)
+
+	mock.ExpectPrepare("INSERT INTO scannedlocation")
+	mock.ExpectExec("INSERT INTO scannedlocation").WillReturnResult(sqlmock.NewResult(1, 1))
+
+	copyOfConn := DbConnection{Username: conn.Username, Password: conn.Password, Host: conn.Host, Port: conn.Port, Database: conn.Database}
+	if err := copyOfConn.AddScannedLocation(1, 2); err != nil {
+		t.Fatalf("AddScannedLocation on a literal-constructed DbConnection: %s", err)
+	}
+}
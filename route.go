@@ -0,0 +1,161 @@
+package gophermon
+
+import (
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kellydunn/golang-geo"
+
+	"github.com/femot/pgoapi-go/api"
+)
+
+// RouteLocationProvider replays a recorded track (loaded from GPX or KML), moving from point to
+// point at SpeedMps. NextLocation blocks for roughly as long as it would take to walk/bike the
+// distance to the next point, so scans driven by it respect realistic human-movement limits.
+type RouteLocationProvider struct {
+	Points   []*api.Location
+	SpeedMps float64
+
+	currentIndex int
+}
+
+// NewRouteLocationProvider creates a RouteLocationProvider that replays points at speedMps.
+func NewRouteLocationProvider(points []*api.Location, speedMps float64) *RouteLocationProvider {
+	return &RouteLocationProvider{Points: points, SpeedMps: speedMps, currentIndex: -1}
+}
+
+func (r *RouteLocationProvider) GetLocations() []*api.Location {
+	return r.Points
+}
+
+// NextLocation advances to the next point on the route, sleeping first for the time it would
+// take to cover the distance from the current point at SpeedMps.
+func (r *RouteLocationProvider) NextLocation() *api.Location {
+	if len(r.Points) == 0 {
+		return &api.Location{}
+	}
+	if r.currentIndex >= 0 && r.SpeedMps > 0 {
+		prev := r.Points[r.currentIndex]
+		next := r.Points[(r.currentIndex+1)%len(r.Points)]
+		dist := 1000 * geo.NewPoint(prev.Lat, prev.Lon).GreatCircleDistance(geo.NewPoint(next.Lat, next.Lon))
+		time.Sleep(time.Duration(dist / r.SpeedMps * float64(time.Second)))
+	}
+	r.currentIndex++
+	if r.currentIndex >= len(r.Points) {
+		r.currentIndex = 0
+	}
+	location := r.Points[r.currentIndex]
+	setRandomAccuracy(location)
+	return location
+}
+
+// NewRouteProviderFromGPX builds a RouteLocationProvider from a GPX 1.1 document's <trkpt>
+// sequence. If elev is non-nil, altitudes are looked up through it instead of the <ele> values
+// embedded in the GPX file.
+func NewRouteProviderFromGPX(r io.Reader, speedMps float64, elev ElevationProvider) (*RouteLocationProvider, error) {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	doc := &gpxDocument{}
+	if err := xml.Unmarshal(body, doc); err != nil {
+		return nil, err
+	}
+	points := make([]*api.Location, 0)
+	for _, trk := range doc.Tracks {
+		for _, seg := range trk.Segments {
+			for _, p := range seg.Points {
+				points = append(points, &api.Location{Lat: p.Lat, Lon: p.Lon, Alt: p.Elevation})
+			}
+		}
+	}
+	if err := resolveAltitudes(points, elev); err != nil {
+		return nil, err
+	}
+	return NewRouteLocationProvider(points, speedMps), nil
+}
+
+// NewRouteProviderFromKML builds a RouteLocationProvider from a KML document's <coordinates>
+// list ("lon,lat[,alt]" tuples). If elev is non-nil, altitudes are looked up through it instead
+// of any altitude embedded in the KML file.
+func NewRouteProviderFromKML(r io.Reader, speedMps float64, elev ElevationProvider) (*RouteLocationProvider, error) {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	doc := &kmlDocument{}
+	if err := xml.Unmarshal(body, doc); err != nil {
+		return nil, err
+	}
+	points := make([]*api.Location, 0)
+	for _, coordinates := range doc.Coordinates {
+		for _, tuple := range strings.Fields(coordinates) {
+			parts := strings.Split(tuple, ",")
+			if len(parts) < 2 {
+				continue
+			}
+			lon, err := strconv.ParseFloat(parts[0], 64)
+			if err != nil {
+				return nil, err
+			}
+			lat, err := strconv.ParseFloat(parts[1], 64)
+			if err != nil {
+				return nil, err
+			}
+			location := &api.Location{Lat: lat, Lon: lon}
+			if len(parts) >= 3 {
+				if alt, err := strconv.ParseFloat(parts[2], 64); err == nil {
+					location.Alt = alt
+				}
+			}
+			points = append(points, location)
+		}
+	}
+	if err := resolveAltitudes(points, elev); err != nil {
+		return nil, err
+	}
+	return NewRouteLocationProvider(points, speedMps), nil
+}
+
+// resolveAltitudes overwrites the altitude of every point using elev, unless elev is nil.
+func resolveAltitudes(points []*api.Location, elev ElevationProvider) error {
+	if elev == nil {
+		return nil
+	}
+	elevations, err := elev.LookupAltitudes(points)
+	if err != nil {
+		return err
+	}
+	for i, e := range elevations {
+		points[i].Alt = e
+	}
+	return nil
+}
+
+type gpxDocument struct {
+	XMLName xml.Name   `xml:"gpx"`
+	Tracks  []gpxTrack `xml:"trk"`
+}
+
+type gpxTrack struct {
+	Segments []gpxSegment `xml:"trkseg"`
+}
+
+type gpxSegment struct {
+	Points []gpxPoint `xml:"trkpt"`
+}
+
+type gpxPoint struct {
+	Lat       float64 `xml:"lat,attr"`
+	Lon       float64 `xml:"lon,attr"`
+	Elevation float64 `xml:"ele"`
+}
+
+type kmlDocument struct {
+	XMLName     xml.Name `xml:"kml"`
+	Coordinates []string `xml:"Document>Placemark>LineString>coordinates"`
+}
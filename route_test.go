@@ -0,0 +1,125 @@
+package gophermon
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kellydunn/golang-geo"
+
+	"github.com/femot/pgoapi-go/api"
+)
+
+const testGPX = `<?xml version="1.0"?>
+<gpx version="1.1">
+  <trk>
+    <trkseg>
+      <trkpt lat="37.1000" lon="-122.1000"><ele>10</ele></trkpt>
+      <trkpt lat="37.1001" lon="-122.1001"><ele>11</ele></trkpt>
+    </trkseg>
+  </trk>
+</gpx>`
+
+const testKML = `<?xml version="1.0"?>
+<kml>
+  <Document>
+    <Placemark>
+      <LineString>
+        <coordinates>-122.1000,37.1000,10 -122.1001,37.1001,11</coordinates>
+      </LineString>
+    </Placemark>
+  </Document>
+</kml>`
+
+func TestNewRouteProviderFromGPX(t *testing.T) {
+	provider, err := NewRouteProviderFromGPX(strings.NewReader(testGPX), 1.4, nil)
+	if err != nil {
+		t.Fatalf("NewRouteProviderFromGPX: %s", err)
+	}
+	points := provider.GetLocations()
+	if len(points) != 2 {
+		t.Fatalf("expected 2 points, got %d", len(points))
+	}
+	if points[0].Lat != 37.1000 || points[0].Lon != -122.1000 || points[0].Alt != 10 {
+		t.Errorf("unexpected first point: %+v", points[0])
+	}
+	if points[1].Lat != 37.1001 || points[1].Lon != -122.1001 || points[1].Alt != 11 {
+		t.Errorf("unexpected second point: %+v", points[1])
+	}
+}
+
+func TestNewRouteProviderFromGPX_ElevationOverride(t *testing.T) {
+	elev := &countingElevationProvider{alt: 99}
+	provider, err := NewRouteProviderFromGPX(strings.NewReader(testGPX), 1.4, elev)
+	if err != nil {
+		t.Fatalf("NewRouteProviderFromGPX: %s", err)
+	}
+	for _, p := range provider.GetLocations() {
+		if p.Alt != 99 {
+			t.Errorf("expected elev provider's altitude to override <ele>, got %f", p.Alt)
+		}
+	}
+	if elev.calls != 2 {
+		t.Errorf("expected the elevation provider to be asked about both points, got %d calls", elev.calls)
+	}
+}
+
+func TestNewRouteProviderFromKML(t *testing.T) {
+	provider, err := NewRouteProviderFromKML(strings.NewReader(testKML), 1.4, nil)
+	if err != nil {
+		t.Fatalf("NewRouteProviderFromKML: %s", err)
+	}
+	points := provider.GetLocations()
+	if len(points) != 2 {
+		t.Fatalf("expected 2 points, got %d", len(points))
+	}
+	if points[0].Lat != 37.1000 || points[0].Lon != -122.1000 || points[0].Alt != 10 {
+		t.Errorf("unexpected first point: %+v", points[0])
+	}
+	if points[1].Lat != 37.1001 || points[1].Lon != -122.1001 || points[1].Alt != 11 {
+		t.Errorf("unexpected second point: %+v", points[1])
+	}
+}
+
+func TestRouteLocationProvider_NextLocationWraps(t *testing.T) {
+	points := []*api.Location{{Lat: 1, Lon: 1}, {Lat: 2, Lon: 2}}
+	// SpeedMps of 0 disables the inter-point sleep, so this test runs instantly.
+	provider := NewRouteLocationProvider(points, 0)
+
+	first := provider.NextLocation()
+	if first != points[0] {
+		t.Fatalf("expected first call to return points[0], got %+v", first)
+	}
+	second := provider.NextLocation()
+	if second != points[1] {
+		t.Fatalf("expected second call to return points[1], got %+v", second)
+	}
+	third := provider.NextLocation()
+	if third != points[0] {
+		t.Fatalf("expected third call to wrap around to points[0], got %+v", third)
+	}
+}
+
+func TestRouteLocationProvider_NextLocation_SleepsForSubSecondSegments(t *testing.T) {
+	// Regression test: the sleep duration must be computed as a float number of seconds and
+	// scaled to nanoseconds before being rounded to a time.Duration. Rounding to a whole number
+	// of seconds first would truncate any segment under SpeedMps apart to a 0s sleep.
+	points := []*api.Location{{Lat: 1, Lon: 1}, {Lat: 1.001, Lon: 1}}
+	dist := 1000 * geo.NewPoint(points[0].Lat, points[0].Lon).GreatCircleDistance(geo.NewPoint(points[1].Lat, points[1].Lon))
+	const speedMps = 50000.0
+	want := time.Duration(dist / speedMps * float64(time.Second))
+	if want <= 0 || want >= time.Second {
+		t.Fatalf("test fixture invalid: want a small nonzero sleep, got %s", want)
+	}
+
+	provider := NewRouteLocationProvider(points, speedMps)
+	provider.NextLocation()
+
+	start := time.Now()
+	provider.NextLocation()
+	elapsed := time.Since(start)
+
+	if elapsed < want {
+		t.Errorf("expected NextLocation to sleep at least %s before returning the next point, only took %s", want, elapsed)
+	}
+}
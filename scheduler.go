@@ -0,0 +1,410 @@
+package gophermon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kellydunn/golang-geo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/femot/pgoapi-go/api"
+)
+
+// TrainerState describes where a trainer account is in its scanning lifecycle.
+type TrainerState int
+
+const (
+	// Fresh trainers have never logged in yet.
+	Fresh TrainerState = iota
+	// Warmup trainers have logged in but not yet completed a successful scan.
+	Warmup
+	// Active trainers are scanning normally.
+	Active
+	// Throttled trainers are backing off after a login or RPC failure.
+	Throttled
+	// Banned trainers have failed enough times in a row that they're taken out of rotation.
+	Banned
+)
+
+func (s TrainerState) String() string {
+	switch s {
+	case Fresh:
+		return "fresh"
+	case Warmup:
+		return "warmup"
+	case Active:
+		return "active"
+	case Throttled:
+		return "throttled"
+	case Banned:
+		return "banned"
+	default:
+		return "unknown"
+	}
+}
+
+// maxSchedulerFailures is how many consecutive login/RPC failures move a trainer from Throttled
+// to Banned.
+const maxSchedulerFailures = 8
+
+// AssignmentStrategy picks which pending cell an idle trainer scans next.
+type AssignmentStrategy int
+
+const (
+	// RoundRobin hands out cells in the order they were queued.
+	RoundRobin AssignmentStrategy = iota
+	// NearestFirst hands each trainer the pending cell closest to its current location.
+	NearestFirst
+)
+
+// schedulerTrainer bundles a TrainerSession with the state the Scheduler tracks for it.
+type schedulerTrainer struct {
+	session      *TrainerSession
+	state        TrainerState
+	failures     int
+	backoffUntil time.Time
+	busy         bool
+}
+
+// Scheduler coordinates a set of TrainerSessions scanning a shared set of pending cells. It
+// replaces the ad-hoc goroutine choreography previously driven through TrainerSession.Hunt and a
+// single shared locations/ticks channel: trainers are assigned cells directly, their health is
+// tracked individually, and both are observable through Prometheus metrics and a small HTTP admin
+// API.
+type Scheduler struct {
+	Strategy  AssignmentStrategy
+	ScanDelay time.Duration
+	// Feed and Crypto are used to build TrainerSessions for accounts added at runtime through
+	// ServeAdmin's POST /trainers, the same way LoadTrainers builds them at startup.
+	Feed   api.Feed
+	Crypto api.Crypto
+
+	mu       sync.Mutex
+	trainers map[string]*schedulerTrainer
+	pending  []*api.Location
+
+	scansTotal   prometheus.Counter
+	errorsTotal  prometheus.Counter
+	trainerGauge *prometheus.GaugeVec
+}
+
+// NewScheduler creates an empty Scheduler. Trainers and cells are added with AddTrainer and
+// AddCells before calling Run. feed and crypto are used to build TrainerSessions for accounts
+// added later through ServeAdmin.
+func NewScheduler(strategy AssignmentStrategy, feed api.Feed, crypto api.Crypto) *Scheduler {
+	return &Scheduler{
+		Strategy:  strategy,
+		ScanDelay: time.Duration(ScanDelay) * time.Second,
+		Feed:      feed,
+		Crypto:    crypto,
+		trainers:  make(map[string]*schedulerTrainer),
+		scansTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "gophermon_scans_total",
+			Help: "Total number of completed map scans.",
+		}),
+		errorsTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "gophermon_scan_errors_total",
+			Help: "Total number of scan errors (login or RPC failures).",
+		}),
+		trainerGauge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gophermon_trainers",
+			Help: "Number of trainers in each state.",
+		}, []string{"state"}),
+	}
+}
+
+// Describe and Collect make Scheduler itself a prometheus.Collector, so it can be registered
+// directly with a prometheus.Registry.
+func (s *Scheduler) Describe(ch chan<- *prometheus.Desc) {
+	s.scansTotal.Describe(ch)
+	s.errorsTotal.Describe(ch)
+	s.trainerGauge.Describe(ch)
+}
+
+func (s *Scheduler) Collect(ch chan<- prometheus.Metric) {
+	s.mu.Lock()
+	counts := map[TrainerState]int{}
+	for _, t := range s.trainers {
+		counts[t.state]++
+	}
+	s.mu.Unlock()
+	for _, state := range []TrainerState{Fresh, Warmup, Active, Throttled, Banned} {
+		s.trainerGauge.WithLabelValues(state.String()).Set(float64(counts[state]))
+	}
+	s.scansTotal.Collect(ch)
+	s.errorsTotal.Collect(ch)
+	s.trainerGauge.Collect(ch)
+}
+
+// AddTrainer adds a trainer to the pool, in the Fresh state.
+func (s *Scheduler) AddTrainer(t *TrainerSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.trainers[t.Username] = &schedulerTrainer{session: t, state: Fresh}
+}
+
+// RemoveTrainer takes a trainer out of rotation. It does not stop a scan already in flight.
+func (s *Scheduler) RemoveTrainer(username string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.trainers, username)
+}
+
+// AddCells queues cells to be scanned. Cells are scanned in the order added under RoundRobin, or
+// by proximity to the assigned trainer under NearestFirst.
+func (s *Scheduler) AddCells(cells []*api.Location) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = append(s.pending, cells...)
+}
+
+// ReassignCells discards any pending cells and replaces them with cells, letting operators
+// redirect trainers to a new polygon at runtime.
+func (s *Scheduler) ReassignCells(cells []*api.Location) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = append([]*api.Location{}, cells...)
+}
+
+// Run starts the central dispatch loop: every ScanDelay it assigns pending cells to idle
+// trainers and lets each assignment run in its own goroutine, handing results to sink. Run
+// blocks until ctx is canceled.
+func (s *Scheduler) Run(ctx context.Context, sink ResultSink) {
+	ticker := time.NewTicker(s.ScanDelay)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.dispatch(ctx, sink)
+		}
+	}
+}
+
+// dispatch assigns as many pending cells as there are idle, usable trainers.
+func (s *Scheduler) dispatch(ctx context.Context, sink ResultSink) {
+	for {
+		trainer, cell := s.claimAssignment()
+		if trainer == nil || cell == nil {
+			return
+		}
+		go s.scan(ctx, trainer, cell, sink)
+	}
+}
+
+// claimAssignment picks one idle, usable trainer and one pending cell for it, marking the
+// trainer busy so it isn't picked again before the goroutine finishes.
+func (s *Scheduler) claimAssignment() (*schedulerTrainer, *api.Location) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.pending) == 0 {
+		return nil, nil
+	}
+	var trainer *schedulerTrainer
+	for _, t := range s.trainers {
+		if t.busy || t.state == Banned {
+			continue
+		}
+		if t.state == Throttled && time.Now().Before(t.backoffUntil) {
+			continue
+		}
+		trainer = t
+		if s.Strategy == NearestFirst {
+			break
+		}
+	}
+	if trainer == nil {
+		return nil, nil
+	}
+	index := 0
+	if s.Strategy == NearestFirst {
+		index = nearestCellIndex(trainer.session.Location, s.pending)
+	}
+	cell := s.pending[index]
+	s.pending = append(s.pending[:index], s.pending[index+1:]...)
+	trainer.busy = true
+	return trainer, cell
+}
+
+// nearestCellIndex returns the index of the pending cell closest to from.
+func nearestCellIndex(from *api.Location, cells []*api.Location) int {
+	best := 0
+	bestDist := math.Inf(1)
+	origin := geo.NewPoint(from.Lat, from.Lon)
+	for i, c := range cells {
+		d := origin.GreatCircleDistance(geo.NewPoint(c.Lat, c.Lon))
+		if d < bestDist {
+			bestDist = d
+			best = i
+		}
+	}
+	return best
+}
+
+// scan performs one login-if-needed, move and scan cycle for trainer at cell, hands the result
+// to sink, then returns the trainer to the idle pool with its state updated based on the outcome.
+func (s *Scheduler) scan(ctx context.Context, trainer *schedulerTrainer, cell *api.Location, sink ResultSink) {
+	defer s.finishAssignment(trainer)
+
+	session := trainer.session
+	if session.Session == nil || session.Session.IsExpired() {
+		if err := session.Login(); err != nil {
+			s.recordFailure(trainer, err)
+			return
+		}
+		s.mu.Lock()
+		if trainer.state == Fresh {
+			trainer.state = Warmup
+		}
+		s.mu.Unlock()
+	}
+
+	session.MoveTo(cell)
+	resp, err := session.GetPlayerMap()
+	if err == api.ErrNewRPCURL {
+		resp, err = session.GetPlayerMap()
+	}
+	if err != nil {
+		s.recordFailure(trainer, err)
+		return
+	}
+
+	if err := sink.OnMapObjects(ctx, cell, resp); err != nil {
+		log.Printf("gophermon: sink failed for <%s>: %s", session.Username, err)
+	}
+	s.scansTotal.Inc()
+	s.recordSuccess(trainer)
+}
+
+// finishAssignment returns the trainer to the idle pool.
+func (s *Scheduler) finishAssignment(trainer *schedulerTrainer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	trainer.busy = false
+}
+
+// recordSuccess clears a trainer's failure streak and promotes it out of Warmup/Throttled.
+func (s *Scheduler) recordSuccess(trainer *schedulerTrainer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	trainer.failures = 0
+	if trainer.state == Warmup || trainer.state == Throttled {
+		trainer.state = Active
+	}
+}
+
+// recordFailure bumps a trainer's failure streak, applying exponential backoff, and bans it once
+// maxSchedulerFailures is reached.
+func (s *Scheduler) recordFailure(trainer *schedulerTrainer, err error) {
+	s.errorsTotal.Inc()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	trainer.failures++
+	log.Printf("gophermon: scan failed for <%s> (failure %d): %s", trainer.session.Username, trainer.failures, err)
+	if trainer.failures >= maxSchedulerFailures {
+		trainer.state = Banned
+		return
+	}
+	trainer.state = Throttled
+	backoff := time.Duration(1<<uint(trainer.failures)) * time.Second
+	trainer.backoffUntil = time.Now().Add(backoff)
+}
+
+// trainerStatus is the JSON shape returned by the admin API for a single trainer.
+type trainerStatus struct {
+	Username string `json:"username"`
+	State    string `json:"state"`
+	Failures int    `json:"failures"`
+}
+
+// addTrainerRequest is the JSON body expected by POST /trainers.
+type addTrainerRequest struct {
+	Provider string       `json:"provider"`
+	Username string       `json:"username"`
+	Password string       `json:"password"`
+	Location api.Location `json:"location"`
+}
+
+// ServeMetrics starts an HTTP server exposing Scheduler's stats at /metrics in Prometheus
+// exposition format. It blocks until the server stops.
+func (s *Scheduler) ServeMetrics(addr string) error {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(s)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	return http.ListenAndServe(addr, mux)
+}
+
+// ServeAdmin starts a small HTTP admin API for adding/removing accounts and reassigning polygons
+// at runtime:
+//
+//	GET    /trainers           list trainers and their state
+//	POST   /trainers           add a trainer (JSON addTrainerRequest)
+//	DELETE /trainers?username= remove a trainer
+//	POST   /cells              replace the pending cells (JSON array of api.Location)
+//
+// It blocks until the server stops.
+func (s *Scheduler) ServeAdmin(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/trainers", s.handleTrainers)
+	mux.HandleFunc("/cells", s.handleCells)
+	return http.ListenAndServe(addr, mux)
+}
+
+func (s *Scheduler) handleTrainers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		statuses := make([]trainerStatus, 0, len(s.trainers))
+		for _, t := range s.trainers {
+			statuses = append(statuses, trainerStatus{Username: t.session.Username, State: t.state.String(), Failures: t.failures})
+		}
+		s.mu.Unlock()
+		json.NewEncoder(w).Encode(statuses)
+	case http.MethodPost:
+		var req addTrainerRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Provider == "" || req.Username == "" {
+			http.Error(w, "missing provider or username", http.StatusBadRequest)
+			return
+		}
+		trainer := NewTrainerSession(req.Provider, req.Username, req.Password, &req.Location, s.Feed, s.Crypto)
+		s.AddTrainer(trainer)
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		username := r.URL.Query().Get("username")
+		if username == "" {
+			http.Error(w, "missing username", http.StatusBadRequest)
+			return
+		}
+		s.RemoveTrainer(username)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, fmt.Sprintf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Scheduler) handleCells(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, fmt.Sprintf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	cells := make([]*api.Location, 0)
+	if err := json.NewDecoder(r.Body).Decode(&cells); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.ReassignCells(cells)
+	w.WriteHeader(http.StatusNoContent)
+}
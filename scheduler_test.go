@@ -0,0 +1,94 @@
+package gophermon
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/femot/pgoapi-go/api"
+)
+
+func newTestTrainer(username string) *schedulerTrainer {
+	session := NewTrainerSession("ptc", username, "pw", &api.Location{}, nil, nil)
+	return &schedulerTrainer{session: session, state: Fresh}
+}
+
+func TestScheduler_RecordFailure_ThrottlesThenBans(t *testing.T) {
+	s := NewScheduler(RoundRobin, nil, nil)
+	trainer := newTestTrainer("t1")
+
+	for i := 1; i < maxSchedulerFailures; i++ {
+		s.recordFailure(trainer, errors.New("boom"))
+		if trainer.state != Throttled {
+			t.Fatalf("expected Throttled after %d failures, got %s", i, trainer.state)
+		}
+		if !trainer.backoffUntil.After(time.Now()) {
+			t.Fatalf("expected backoffUntil to be in the future after failure %d", i)
+		}
+	}
+
+	s.recordFailure(trainer, errors.New("boom"))
+	if trainer.state != Banned {
+		t.Fatalf("expected Banned after %d consecutive failures, got %s", maxSchedulerFailures, trainer.state)
+	}
+}
+
+func TestScheduler_RecordSuccess_ResetsFailures(t *testing.T) {
+	s := NewScheduler(RoundRobin, nil, nil)
+	trainer := newTestTrainer("t1")
+	trainer.state = Throttled
+	trainer.failures = 3
+
+	s.recordSuccess(trainer)
+
+	if trainer.failures != 0 {
+		t.Errorf("expected failures to reset to 0, got %d", trainer.failures)
+	}
+	if trainer.state != Active {
+		t.Errorf("expected state Active after success, got %s", trainer.state)
+	}
+}
+
+func TestScheduler_ClaimAssignment_SkipsBusyThrottledAndBanned(t *testing.T) {
+	s := NewScheduler(RoundRobin, nil, nil)
+
+	busy := newTestTrainer("busy")
+	busy.busy = true
+	banned := newTestTrainer("banned")
+	banned.state = Banned
+	throttled := newTestTrainer("throttled")
+	throttled.state = Throttled
+	throttled.backoffUntil = time.Now().Add(time.Hour)
+	idle := newTestTrainer("idle")
+	idle.state = Active
+
+	s.trainers[busy.session.Username] = busy
+	s.trainers[banned.session.Username] = banned
+	s.trainers[throttled.session.Username] = throttled
+	s.trainers[idle.session.Username] = idle
+	s.pending = []*api.Location{{Lat: 1, Lon: 1}}
+
+	trainer, cell := s.claimAssignment()
+	if trainer == nil || trainer.session.Username != "idle" {
+		t.Fatalf("expected the idle trainer to be claimed, got %+v", trainer)
+	}
+	if cell == nil {
+		t.Fatalf("expected a cell to be claimed")
+	}
+	if !idle.busy {
+		t.Errorf("expected the claimed trainer to be marked busy")
+	}
+	if len(s.pending) != 0 {
+		t.Errorf("expected the claimed cell to be removed from pending, got %d left", len(s.pending))
+	}
+}
+
+func TestScheduler_ClaimAssignment_NoTrainersAvailable(t *testing.T) {
+	s := NewScheduler(RoundRobin, nil, nil)
+	s.pending = []*api.Location{{Lat: 1, Lon: 1}}
+
+	trainer, cell := s.claimAssignment()
+	if trainer != nil || cell != nil {
+		t.Fatalf("expected no assignment with no trainers, got %+v, %+v", trainer, cell)
+	}
+}
@@ -0,0 +1,107 @@
+package gophermon
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pogodevorg/POGOProtos-go"
+
+	"github.com/femot/gophermon/mapsql"
+	"github.com/femot/pgoapi-go/api"
+)
+
+// ResultSink receives the results of a single map scan. Implementations decide what happens to
+// them, whether that's persisting to a database, forwarding to a queue, dumping to disk for
+// offline analysis, or some combination via MultiSink.
+type ResultSink interface {
+	// OnMapObjects is called once per successful scan, with the location that was scanned and
+	// the raw response from the server.
+	OnMapObjects(ctx context.Context, loc *api.Location, resp *protos.GetMapObjectsResponse) error
+}
+
+// MultiSink fans a single scan result out to every sink in the slice. It returns the first error
+// encountered, but still gives every sink a chance to run.
+type MultiSink []ResultSink
+
+// OnMapObjects calls OnMapObjects on every sink in m.
+func (m MultiSink) OnMapObjects(ctx context.Context, loc *api.Location, resp *protos.GetMapObjectsResponse) error {
+	var firstErr error
+	for _, sink := range m {
+		if err := sink.OnMapObjects(ctx, loc, resp); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// MapSQLSink persists scanned locations and the wild pokemon found at them through a
+// mapsql.DbConnection, deduping pokemon by encounter ID. Nearby pokemon are not stored.
+type MapSQLSink struct {
+	DB mapsql.DbConnection
+}
+
+// OnMapObjects records loc as scanned and upserts every wild pokemon found in resp; nearby
+// pokemon in resp are ignored.
+func (m MapSQLSink) OnMapObjects(ctx context.Context, loc *api.Location, resp *protos.GetMapObjectsResponse) error {
+	if err := m.DB.UpsertScannedLocationCtx(ctx, loc.Lat, loc.Lon); err != nil {
+		return err
+	}
+	pokemons := extractPokemon(resp)
+	if len(pokemons) == 0 {
+		return nil
+	}
+	return m.DB.UpsertPokemonBatchCtx(ctx, pokemons)
+}
+
+// extractPokemon walks resp's map cells and returns every wild pokemon found, ready for
+// persistence through mapsql.
+//
+// NearbyPokemon entries are deliberately skipped: Niantic's API gives no coordinates for them
+// (only a distance) and no disappear time, and the pokemon table's disappear_time column has no
+// sensible value to store for them.
+func extractPokemon(resp *protos.GetMapObjectsResponse) []mapsql.Pokemon {
+	pokemons := make([]mapsql.Pokemon, 0)
+	for _, cell := range resp.MapCells {
+		for _, wild := range cell.GetWildPokemons() {
+			pokemons = append(pokemons, mapsql.Pokemon{
+				EncounterId:   strconv.FormatUint(wild.EncounterId, 10),
+				SpawnpointId:  wild.SpawnPointId,
+				PokemonId:     int(wild.GetPokemonData().GetPokemonId()),
+				Latitude:      wild.Latitude,
+				Longitude:     wild.Longitude,
+				DisappearTime: time.Now().Add(time.Duration(wild.TimeTillHiddenMs) * time.Millisecond),
+			})
+		}
+	}
+	return pokemons
+}
+
+// JSONFileSink appends one JSON record per scan to a file on disk, for offline analysis. It's
+// safe for concurrent use by multiple goroutines.
+type JSONFileSink struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// jsonFileSinkRecord is the shape of each line written by JSONFileSink.
+type jsonFileSinkRecord struct {
+	Location *api.Location                 `json:"location"`
+	Response *protos.GetMapObjectsResponse `json:"response"`
+}
+
+// OnMapObjects appends loc and resp as a single JSON line to j.Path.
+func (j *JSONFileSink) OnMapObjects(ctx context.Context, loc *api.Location, resp *protos.GetMapObjectsResponse) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	f, err := os.OpenFile(j.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(jsonFileSinkRecord{Location: loc, Response: resp})
+}
@@ -7,7 +7,6 @@ import (
 
 	"github.com/pogodevorg/POGOProtos-go"
 
-	"github.com/femot/gophermon/mapsql"
 	"github.com/femot/pgoapi-go/api"
 	"github.com/femot/pgoapi-go/auth"
 )
@@ -51,9 +50,9 @@ func NewTrainerSession(provider, username, password string, location *api.Locati
 }
 
 // Hunt sends the trainer to scan for pokemon.
-// Locations to scan are received from the locations channel and results get sent to the results channel.
+// Locations to scan are received from the locations channel and results are handed to sink.
 // The ticks channel is used for coordination to limit Niantic API calls per second.
-func (t *TrainerSession) Hunt(locations chan *api.Location, results chan *protos.GetMapObjectsResponse, ticks chan bool, db mapsql.DbConnection) {
+func (t *TrainerSession) Hunt(locations chan *api.Location, ticks chan bool, sink ResultSink) {
 	// Stagger logins, too
 	<-ticks
 	t.Login()
@@ -91,25 +90,20 @@ func (t *TrainerSession) Hunt(locations chan *api.Location, results chan *protos
 		log.Printf("Hunting at: %f, %f (%s)\n", t.Location.Lat, t.Location.Lon, t.Username)
 
 		// Define a func for requesting map objects. We may need to call this twice per loop
-		f := func(a chan *protos.GetMapObjectsResponse, b *TrainerSession) error {
-			if r, err := t.GetPlayerMap(); err == nil {
-				results <- r
-				err = db.AddScannedLocation(t.Location.Lat, t.Location.Lon)
-				if err != nil {
-					return err
-				}
-			} else {
+		f := func(t *TrainerSession) error {
+			r, err := t.GetPlayerMap()
+			if err != nil {
 				return err
 			}
-			return nil
+			return sink.OnMapObjects(t.Context, t.Location, r)
 		}
 
-		err := f(results, t)
+		err := f(t)
 		// Retry after receiving new API URL
 		if err != nil && err == api.ErrNewRPCURL {
 			// Need to wait before retry
 			<-ticks
-			err = f(results, t)
+			err = f(t)
 		}
 		if err != nil {
 			log.Println(err)